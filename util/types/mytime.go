@@ -14,6 +14,8 @@
 package types
 
 import (
+	"fmt"
+	"strconv"
 	gotime "time"
 
 	"github.com/juju/errors"
@@ -58,30 +60,68 @@ func (t mysqlTime) Microsecond() int {
 }
 
 func (t mysqlTime) Weekday() gotime.Weekday {
-	t1, err := t.GoTime()
-	if err != nil {
-		// TODO: Fix here.
+	if t.isZero() {
 		return 0
 	}
-	return t1.Weekday()
+	return weekdayFromJDN(julianDayNumber(t.Year(), t.Month(), t.Day()))
 }
 
 func (t mysqlTime) YearDay() int {
-	t1, err := t.GoTime()
-	if err != nil {
-		// TODO: Fix here.
+	if t.isZero() {
 		return 0
 	}
-	return t1.YearDay()
+	return calcDaynr(t.Year(), t.Month(), t.Day()) - calcDaynr(t.Year(), 1, 1) + 1
 }
 
 func (t mysqlTime) ISOWeek() (int, int) {
-	t1, err := t.GoTime()
-	if err != nil {
-		// TODO: Fix here.
+	if t.isZero() {
 		return 0, 0
 	}
-	return t1.ISOWeek()
+	return isoWeekFromJDN(julianDayNumber(t.Year(), t.Month(), t.Day()))
+}
+
+// daynrToJDNOffset converts a calcDaynr day number into a true Julian day
+// number: calcDaynr(1, 1, 1) == 366, while the Julian day number of 0001-01-01
+// (proleptic Gregorian) is 1721426, so the two are related by this constant
+// offset.
+const daynrToJDNOffset = 1721060
+
+// julianDayNumber returns the Julian day number of y-m-d, computed directly
+// from calcDaynr instead of round-tripping through gotime.Date. The result is
+// only meaningful for dates with no zero component (see isZero); the callers
+// check for zero-dates before calling it.
+func julianDayNumber(y, m, d int) int64 {
+	return int64(calcDaynr(y, m, d)) + daynrToJDNOffset
+}
+
+// weekdayFromJDN returns the day of week of a Julian day number. Julian day 0
+// is a Monday, so jdn+1 is 0 on a Sunday, matching gotime.Weekday's numbering.
+func weekdayFromJDN(jdn int64) gotime.Weekday {
+	wd := (jdn + 1) % 7
+	if wd < 0 {
+		wd += 7
+	}
+	return gotime.Weekday(wd)
+}
+
+// isoWeekFromJDN returns the ISO 8601 week-numbering year and week of a
+// Julian day number, using the reduction described in Richards' algorithm for
+// converting a Julian day number into an ISO week date.
+func isoWeekFromJDN(jdn int64) (year, week int) {
+	d4 := (jdn + 31741 - jdn%7) % 146097 % 36524 % 1461
+	l := d4 / 1460
+	d1 := (d4-l)%365 + l
+	week = int(d1/7) + 1
+
+	y, m, _ := calcDaynrToDate(int(jdn - daynrToJDNOffset))
+	year = y
+	switch {
+	case m == 1 && week >= 52:
+		year--
+	case m == 12 && week == 1:
+		year++
+	}
+	return year, week
 }
 
 func (t mysqlTime) GoTime() (gotime.Time, error) {
@@ -124,7 +164,7 @@ func calcDaynr(year, month, day int) int {
 	if month <= 2 {
 		y--
 	} else {
-		delsum -= month*4 + 23/10
+		delsum -= (month*4 + 23) / 10
 	}
 	temp := (y/100 + 1) * 3 / 4
 	return delsum + y/4 - temp
@@ -227,3 +267,312 @@ func calcWeek(t *mysqlTime, wb weekBehaviour, year *int) int {
 	}
 	return days/7 + 1
 }
+
+// daysInMonth gives the length of each month in a non-leap year; calcDaynrToDate
+// accounts for the leap day separately.
+var daysInMonth = [12]int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// calcDaynrToDate is the inverse of calcDaynr: given a day number counted on
+// the same epoch, it reconstructs the year, month and day it refers to.
+func calcDaynrToDate(daynr int) (year, month, day int) {
+	if daynr <= 0 {
+		return 0, 0, 0
+	}
+
+	y := daynr * 100 / 36525
+	temp := ((y-1)/100 + 1) * 3 / 4
+	dayOfYear := daynr - y*365 - (y-1)/4 + temp
+	daysInYear := calcDaysInYear(y)
+	for dayOfYear > daysInYear {
+		dayOfYear -= daysInYear
+		y++
+		daysInYear = calcDaysInYear(y)
+	}
+
+	leapDay := 0
+	if daysInYear == 366 {
+		if dayOfYear > 31+28 {
+			dayOfYear--
+			if dayOfYear == 31+28 {
+				leapDay = 1
+			}
+		}
+	}
+
+	month = 1
+	for _, dim := range daysInMonth {
+		if dayOfYear <= dim {
+			break
+		}
+		dayOfYear -= dim
+		month++
+	}
+	return y, month, dayOfYear + leapDay
+}
+
+// weekOneStartDaynr returns the day number (see calcDaynr) of the first day of
+// week 1 of year, under the rules selected by wb. It mirrors the first half of
+// calcWeek: it locates the day number of the start of the week that contains
+// January 1st, then, unless that week belongs to the previous week-year,
+// treats it as the start of week 1; otherwise week 1 starts 7 days later.
+func weekOneStartDaynr(year int, wb weekBehaviour) int {
+	mondayFirst := wb.test(weekBehaviourMondayFirst)
+	firstWeekday := wb.test(weekBehaviourWeekFirstWeekday)
+
+	firstDaynr := calcDaynr(year, 1, 1)
+	weekday := calcWeekday(firstDaynr, !mondayFirst)
+	week0Start := firstDaynr - weekday
+
+	if (firstWeekday && weekday != 0) || (!firstWeekday && weekday >= 4) {
+		return week0Start + 7
+	}
+	return week0Start
+}
+
+// maxWeekInYear returns the highest week number calcWeek can report for a
+// date in year under wb whose own calcWeek-computed week-year is still year
+// (i.e. it excludes the trailing days of December that calcWeek rolls forward
+// into week 1 of year+1 under the WEEK_YEAR bit). It probes calcWeek directly
+// over the year's last fortnight instead of re-deriving the bound, so it
+// always agrees with calcWeek, including the WEEK_YEAR-unset modes where a
+// year can have a 53rd week that isn't bounded by where week 1 of year+1
+// starts.
+func maxWeekInYear(year int, wb weekBehaviour) int {
+	max := 0
+	for day := 18; day <= 31; day++ {
+		t := mysqlTime{year: uint16(year), month: 12, day: uint8(day)}
+		y := 0
+		if w := calcWeek(&t, wb, &y); y == year && w > max {
+			max = w
+		}
+	}
+	return max
+}
+
+// NewFromISOWeek is the inverse of calcWeek: given a week-year, a week number
+// and a day of week (1 for the first day of the week through 7 for the last,
+// both following the MONDAY_FIRST bit of mode), it returns the calendar date
+// that week/weekday identifies. week 0 is only accepted when mode's WEEK_YEAR
+// bit is unset; it is then taken as the last week of the previous year and
+// resolves to week maxWeekInYear(year-1, mode) of year-1. Only the days of
+// that week falling in year-1 are returned: the early-January days of year,
+// which calcWeek itself reports as week 0 of year, are rejected with
+// ErrInvalidTimeFormat. It returns ErrInvalidTimeFormat if weekday is out of
+// range or week does not exist in that year under mode.
+//
+// Round-tripping the returned date back through calcWeek reproduces
+// (year, week) for every mode whenever WEEK_YEAR is set, and for week 2
+// through the second-to-last week of the year whenever it isn't. The first
+// and last weeks under a WEEK_YEAR-unset mode can themselves straddle the
+// Dec 31/Jan 1 boundary, and calcWeek classifies a boundary-straddling week
+// by the date actually queried rather than by the week-year requested here,
+// so the days of that week falling outside year do not belong to year's
+// week as far as calcWeek is concerned; NewFromISOWeek rejects those
+// weekday values with ErrInvalidTimeFormat instead of returning a date
+// calcWeek disagrees with.
+func NewFromISOWeek(year, week, weekday int, mode weekBehaviour) (mysqlTime, error) {
+	if weekday < 1 || weekday > 7 || week < 0 {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+
+	max := maxWeekInYear(year, mode)
+	if week == 0 {
+		if mode.test(weekBehaviourWeekYear) {
+			return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+		}
+		year--
+		week = maxWeekInYear(year, mode)
+		max = week
+		if week == 0 {
+			return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+		}
+	} else if week > max {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+
+	start := weekOneStartDaynr(year, mode)
+	daynr := start + (week-1)*7 + (weekday - 1)
+	if !mode.test(weekBehaviourWeekYear) {
+		if week == 1 && daynr < calcDaynr(year, 1, 1) {
+			return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+		}
+		if week == max && daynr >= calcDaynr(year+1, 1, 1) {
+			return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+		}
+	}
+
+	y, m, d := calcDaynrToDate(daynr)
+	return newMysqlTime(y, m, d, 0, 0, 0, 0), nil
+}
+
+// WeekStart returns the first day (per mode's MONDAY_FIRST bit) of the given
+// week, i.e. NewFromISOWeek(year, week, 1, mode).
+func WeekStart(year, week int, mode weekBehaviour) (mysqlTime, error) {
+	return NewFromISOWeek(year, week, 1, mode)
+}
+
+// WeekEndExclusive returns the first day of the week following the given one,
+// so that [WeekStart(year, week, mode), WeekEndExclusive(year, week, mode))
+// is the half-open interval covered by that week.
+func WeekEndExclusive(year, week int, mode weekBehaviour) (mysqlTime, error) {
+	start, err := WeekStart(year, week, mode)
+	if err != nil {
+		return mysqlTime{}, errors.Trace(err)
+	}
+	y, m, d := calcDaynrToDate(calcDaynr(start.Year(), start.Month(), start.Day()) + 7)
+	return newMysqlTime(y, m, d, 0, 0, 0, 0), nil
+}
+
+// isZero reports whether t is a MySQL zero-date component (year, month or day
+// is 0), the cases in which calcDaynr's arithmetic stops being meaningful.
+func (t mysqlTime) isZero() bool {
+	return t.year == 0 || t.month == 0 || t.day == 0
+}
+
+// microsecondsOfDay returns the number of microseconds elapsed since midnight.
+func (t mysqlTime) microsecondsOfDay() int64 {
+	return (int64(t.Hour())*3600+int64(t.Minute())*60+int64(t.Second()))*1e6 + int64(t.Microsecond())
+}
+
+// daysInMonthOf returns the number of days in the given 1-12 month of year,
+// using the well-known trick of asking time.Date for day 0 of the next month.
+func daysInMonthOf(year, month int) int {
+	return gotime.Date(year, gotime.Month(month+1), 0, 0, 0, 0, 0, gotime.UTC).Day()
+}
+
+// Diff returns the calendar-aware absolute difference between t and other, as
+// years, months, days, hours, minutes, seconds and microseconds, in that
+// order from largest to smallest unit. Lower components that go negative
+// borrow from the next-higher one (seconds from minutes, ..., days from
+// months, adding the calendar length of the earlier time's month, months from
+// years). It returns
+// ErrInvalidTimeFormat if either t or other is a zero-date, since borrowing
+// across an invalid month has no well-defined meaning.
+//
+// This is the seam an AGE()-style multi-unit SQL builtin would call into;
+// this checkout has no expression/builtin_time.go to register one in, so
+// that wiring isn't part of this change.
+func (t mysqlTime) Diff(other mysqlTime) (years, months, days, hours, minutes, seconds, microseconds int, err error) {
+	if t.isZero() || other.isZero() {
+		return 0, 0, 0, 0, 0, 0, 0, errors.Trace(ErrInvalidTimeFormat)
+	}
+
+	a, b := t, other
+	aDaynr := calcDaynr(a.Year(), a.Month(), a.Day())
+	bDaynr := calcDaynr(b.Year(), b.Month(), b.Day())
+	if aDaynr > bDaynr || (aDaynr == bDaynr && a.microsecondsOfDay() > b.microsecondsOfDay()) {
+		a, b = b, a
+	}
+
+	years = b.Year() - a.Year()
+	months = b.Month() - a.Month()
+	days = b.Day() - a.Day()
+	hours = b.Hour() - a.Hour()
+	minutes = b.Minute() - a.Minute()
+	seconds = b.Second() - a.Second()
+	microseconds = b.Microsecond() - a.Microsecond()
+
+	if microseconds < 0 {
+		microseconds += 1000000
+		seconds--
+	}
+	if seconds < 0 {
+		seconds += 60
+		minutes--
+	}
+	if minutes < 0 {
+		minutes += 60
+		hours--
+	}
+	if hours < 0 {
+		hours += 24
+		days--
+	}
+	if days < 0 {
+		days += daysInMonthOf(a.Year(), a.Month())
+		months--
+	}
+	if months < 0 {
+		months += 12
+		years--
+	}
+	return years, months, days, hours, minutes, seconds, microseconds, nil
+}
+
+// isoYearHas53Weeks reports whether the ISO week-numbering year starting in
+// year has 53 weeks rather than 52: this holds iff January 1st of year is a
+// Thursday, or year is a leap year and January 1st is a Wednesday.
+func isoYearHas53Weeks(year int) bool {
+	wd := weekdayFromJDN(julianDayNumber(year, 1, 1))
+	if wd == gotime.Thursday {
+		return true
+	}
+	return wd == gotime.Wednesday && calcDaysInYear(year) == 366
+}
+
+// ParseISOWeekDate parses an ISO 8601 week date in one of the four forms
+// YYYY-Www, YYYY-Www-D, YYYYWww or YYYYWwwD (D is the day of week, 1 for
+// Monday through 7 for Sunday, defaulting to 1 when omitted). It returns
+// ErrInvalidTimeFormat if s is malformed, or if it names week 53 of a
+// week-numbering year that only has 52.
+func ParseISOWeekDate(s string) (mysqlTime, error) {
+	if len(s) < 7 {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+
+	year, err := strconv.Atoi(s[0:4])
+	if err != nil || s[0] == '+' || s[0] == '-' {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+	rest := s[4:]
+
+	extended := rest[0] == '-'
+	if extended {
+		rest = rest[1:]
+	}
+	if len(rest) < 3 || (rest[0] != 'W' && rest[0] != 'w') {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+	week, err := strconv.Atoi(rest[1:3])
+	if err != nil || rest[1] == '+' || rest[1] == '-' {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+	rest = rest[3:]
+
+	weekday := 1
+	switch {
+	case len(rest) == 0:
+		// week-only form: defaults to the first day of the week.
+	case extended && len(rest) == 2 && rest[0] == '-':
+		weekday, err = strconv.Atoi(rest[1:2])
+	case !extended && len(rest) == 1:
+		weekday, err = strconv.Atoi(rest)
+	default:
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+	if err != nil {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+
+	if week == 53 && !isoYearHas53Weeks(year) {
+		return mysqlTime{}, errors.Trace(ErrInvalidTimeFormat)
+	}
+	return NewFromISOWeek(year, week, weekday, weekBehaviourMondayFirst|weekBehaviourWeekYear)
+}
+
+// FormatISOWeek formats t as an ISO 8601 week date, YYYY-Www-D in extended
+// form or YYYYWwwD otherwise. It reuses ISOWeek(), and converts Weekday()
+// from Go's Sunday-first numbering to ISO 8601's Monday-first numbering.
+//
+// ParseISOWeekDate and FormatISOWeek are the seams the requested
+// ISOWEEK_FORMAT/STR_TO_ISOWEEK SQL builtins would call into; this checkout
+// has no expression/builtin_time.go to register them in, so that wiring
+// isn't part of this change.
+func (t mysqlTime) FormatISOWeek(extended bool) string {
+	year, week := t.ISOWeek()
+	weekday := ((7 + int(t.Weekday()) - 1) % 7) + 1
+	if extended {
+		return fmt.Sprintf("%04d-W%02d-%d", year, week, weekday)
+	}
+	return fmt.Sprintf("%04dW%02d%d", year, week, weekday)
+}
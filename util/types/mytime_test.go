@@ -0,0 +1,391 @@
+// Copyright 2016 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+	gotime "time"
+)
+
+// allWeekModes covers every MySQL week mode 0-7; the bit meanings are
+// documented in the comment above calcWeek.
+var allWeekModes = []weekBehaviour{0, 1, 2, 3, 4, 5, 6, 7}
+
+// TestNewFromISOWeekRoundTrip checks that NewFromISOWeek is the exact inverse
+// of calcWeek across every week mode. Exhaustively checking every week of
+// every year from 1000-9999 is too slow to run on every build, so for each
+// (year, mode) this samples week 1, the last week of the year and a week
+// near its middle, across all seven weekdays.
+//
+// Week 1 and the last week are excluded here for the WEEK_YEAR-unset modes
+// (0, 1, 4 and 5): as NewFromISOWeek's doc comment explains, those weeks can
+// straddle the Dec 31/Jan 1 boundary, and calcWeek then classifies the side
+// of the week falling outside year as belonging to a different year — so
+// some weekday values are rejected by NewFromISOWeek rather than
+// round-tripping. That boundary behavior is covered separately by
+// TestNewFromISOWeekBoundaryWeeks.
+func TestNewFromISOWeekRoundTrip(t *testing.T) {
+	for _, mode := range allWeekModes {
+		for year := 1000; year <= 9999; year++ {
+			max := maxWeekInYear(year, mode)
+			if max == 0 {
+				t.Fatalf("mode %d year %d: maxWeekInYear returned 0", mode, year)
+			}
+			weeks := []int{(max + 1) / 2}
+			if mode.test(weekBehaviourWeekYear) {
+				weeks = append(weeks, 1, max)
+			}
+			for _, week := range weeks {
+				for weekday := 1; weekday <= 7; weekday++ {
+					got, err := NewFromISOWeek(year, week, weekday, mode)
+					if err != nil {
+						t.Fatalf("mode %d year %d week %d weekday %d: NewFromISOWeek: %v", mode, year, week, weekday, err)
+					}
+					var gotYear int
+					gotWeek := calcWeek(&got, mode, &gotYear)
+					if gotYear != year || gotWeek != week {
+						t.Fatalf("mode %d year %d week %d weekday %d: round trip via %04d-%02d-%02d gave calcWeek year %d week %d",
+							mode, year, week, weekday, got.Year(), got.Month(), got.Day(), gotYear, gotWeek)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestNewFromISOWeekBoundaryWeeks checks the documented boundary behavior
+// for the WEEK_YEAR-unset modes' first and last week of the year: weekday
+// values whose date would actually fall outside year are rejected rather
+// than silently returning a date calcWeek would attribute to a different
+// year, while the remaining weekday values round-trip normally.
+func TestNewFromISOWeekBoundaryWeeks(t *testing.T) {
+	for _, mode := range []weekBehaviour{0, 1, 4, 5} {
+		for year := 1000; year <= 1100; year++ {
+			firstDaynr := calcDaynr(year, 1, 1)
+			nextFirstDaynr := calcDaynr(year+1, 1, 1)
+			max := maxWeekInYear(year, mode)
+			start := weekOneStartDaynr(year, mode)
+			for _, week := range []int{1, max} {
+				for weekday := 1; weekday <= 7; weekday++ {
+					daynr := start + (week-1)*7 + (weekday - 1)
+					got, err := NewFromISOWeek(year, week, weekday, mode)
+					if daynr < firstDaynr || daynr >= nextFirstDaynr {
+						if err == nil {
+							t.Fatalf("mode %d year %d week %d weekday %d: expected ErrInvalidTimeFormat for a date outside year, got %04d-%02d-%02d",
+								mode, year, week, weekday, got.Year(), got.Month(), got.Day())
+						}
+						continue
+					}
+					if err != nil {
+						t.Fatalf("mode %d year %d week %d weekday %d: NewFromISOWeek: %v", mode, year, week, weekday, err)
+					}
+					var gotYear int
+					gotWeek := calcWeek(&got, mode, &gotYear)
+					if gotYear != year || gotWeek != week {
+						t.Fatalf("mode %d year %d week %d weekday %d: round trip via %04d-%02d-%02d gave calcWeek year %d week %d",
+							mode, year, week, weekday, got.Year(), got.Month(), got.Day(), gotYear, gotWeek)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestNewFromISOWeekZero checks the WEEK_YEAR-unset "week 0" case: it must
+// be accepted and resolve into the last week of the previous week-year, and
+// rejected outright when WEEK_YEAR is set (MySQL never returns week 0 then).
+func TestNewFromISOWeekZero(t *testing.T) {
+	const mode = weekBehaviour(0) // Sunday-first, WEEK_YEAR unset, ISO first-week rule
+	got, err := NewFromISOWeek(2000, 0, 1, mode)
+	if err != nil {
+		t.Fatalf("week 0 under a WEEK_YEAR-unset mode should be valid, got error: %v", err)
+	}
+	want := maxWeekInYear(1999, mode)
+	var gotYear int
+	gotWeek := calcWeek(&got, mode, &gotYear)
+	if gotYear != 1999 || gotWeek != want {
+		t.Fatalf("week 0 of 2000 should be week %d of 1999, got year %d week %d", want, gotYear, gotWeek)
+	}
+
+	if _, err := NewFromISOWeek(2000, 0, 1, weekBehaviourWeekYear); err == nil {
+		t.Fatalf("week 0 under a WEEK_YEAR mode should be rejected")
+	}
+}
+
+// TestNewFromISOWeekInvalid checks the straightforward rejection cases.
+func TestNewFromISOWeekInvalid(t *testing.T) {
+	if _, err := NewFromISOWeek(2021, 1, 0, weekBehaviourMondayFirst); err == nil {
+		t.Fatalf("weekday 0 should be rejected")
+	}
+	if _, err := NewFromISOWeek(2021, 1, 8, weekBehaviourMondayFirst); err == nil {
+		t.Fatalf("weekday 8 should be rejected")
+	}
+	// 2021 has 52 ISO weeks (Jan 1 2021 is a Friday, and 2021 is not a leap
+	// year), so week 53 does not exist under the ISO mode (MONDAY_FIRST|WEEK_YEAR).
+	const iso = weekBehaviourMondayFirst | weekBehaviourWeekYear
+	if _, err := NewFromISOWeek(2021, 53, 1, iso); err == nil {
+		t.Fatalf("2021 has no ISO week 53")
+	}
+}
+
+// mkTime is a small helper building a mysqlTime for the Diff tests below.
+func mkTime(year, month, day, hour, minute, second, microsecond int) mysqlTime {
+	return newMysqlTime(year, month, day, hour, minute, second, microsecond)
+}
+
+// TestDiffMonthBoundary exercises the day/month borrow, including the exact
+// case the request names: 2021-01-31 to 2021-03-01 must borrow the length of
+// a's month (January, 31 days), not the month before b's (February).
+//
+// mysqlTime carries no time zone, so a DST transition can't be expressed at
+// this layer; Diff operates purely on calendar/clock components.
+func TestDiffMonthBoundary(t *testing.T) {
+	cases := []struct {
+		a, b                                   mysqlTime
+		years, months, days, hours, minutes, s int
+	}{
+		{mkTime(2021, 1, 31, 0, 0, 0, 0), mkTime(2021, 3, 1, 0, 0, 0, 0), 0, 1, 1, 0, 0, 0},
+		{mkTime(2021, 1, 30, 0, 0, 0, 0), mkTime(2021, 3, 1, 0, 0, 0, 0), 0, 1, 2, 0, 0, 0},
+		{mkTime(2021, 2, 28, 0, 0, 0, 0), mkTime(2021, 3, 1, 0, 0, 0, 0), 0, 0, 1, 0, 0, 0},
+		{mkTime(2019, 12, 31, 0, 0, 0, 0), mkTime(2020, 1, 1, 0, 0, 0, 0), 0, 0, 1, 0, 0, 0},
+	}
+	for _, c := range cases {
+		years, months, days, hours, minutes, seconds, micros, err := c.a.Diff(c.b)
+		if err != nil {
+			t.Fatalf("Diff(%v, %v): unexpected error: %v", c.a, c.b, err)
+		}
+		if years != c.years || months != c.months || days != c.days || hours != c.hours || minutes != c.minutes || seconds != c.s || micros != 0 {
+			t.Fatalf("Diff(%v, %v) = %d %d %d %d %d %d %d, want %d %d %d %d %d %d 0",
+				c.a, c.b, years, months, days, hours, minutes, seconds, micros,
+				c.years, c.months, c.days, c.hours, c.minutes, c.s)
+		}
+	}
+}
+
+// TestDiffLeapDaySpan checks that the borrowed month length accounts for leap
+// years: Feb 2020 has 29 days (2020 is a leap year) while Feb 2021 has 28, and
+// that Diff's borrow uses whichever is correct for the span it crosses.
+func TestDiffLeapDaySpan(t *testing.T) {
+	if got := daysInMonthOf(2020, 2); got != 29 {
+		t.Fatalf("daysInMonthOf(2020, 2) = %d, want 29", got)
+	}
+	if got := daysInMonthOf(2021, 2); got != 28 {
+		t.Fatalf("daysInMonthOf(2021, 2) = %d, want 28", got)
+	}
+
+	years, months, days, _, _, _, _, err := mkTime(2020, 2, 29, 0, 0, 0, 0).Diff(mkTime(2020, 4, 1, 0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if years != 0 || months != 1 || days != 1 {
+		t.Fatalf("2020-02-29 to 2020-04-01 = %d %d %d, want 0 1 1", years, months, days)
+	}
+}
+
+// TestDiffZeroDate checks that zero-date components are rejected rather than
+// silently borrowed across an invalid month.
+func TestDiffZeroDate(t *testing.T) {
+	zero := mkTime(2021, 0, 1, 0, 0, 0, 0)
+	if _, _, _, _, _, _, _, err := zero.Diff(mkTime(2021, 1, 1, 0, 0, 0, 0)); err == nil {
+		t.Fatalf("Diff involving a zero-month date should error")
+	}
+}
+
+// TestDiffSymmetric checks that Diff(a, b) and Diff(b, a) agree, regardless
+// of argument order.
+func TestDiffSymmetric(t *testing.T) {
+	a := mkTime(2021, 1, 31, 23, 59, 59, 999999)
+	b := mkTime(2021, 3, 1, 0, 0, 0, 1)
+	want := [7]int{}
+	want[0], want[1], want[2], want[3], want[4], want[5], want[6] = func() (int, int, int, int, int, int, int) {
+		y, mo, d, h, mi, s, us, err := a.Diff(b)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return y, mo, d, h, mi, s, us
+	}()
+	y, mo, d, h, mi, s, us, err := b.Diff(a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := [7]int{y, mo, d, h, mi, s, us}
+	if got != want {
+		t.Fatalf("Diff(b, a) = %v, want %v (same as Diff(a, b))", got, want)
+	}
+}
+
+// oldWeekday, oldYearDay and oldISOWeek reproduce the GoTime-based
+// implementations the Julian-day-number fast path replaced, kept here so the
+// two can be compared for correctness and speed.
+func oldWeekday(t mysqlTime) gotime.Weekday {
+	t1, err := t.GoTime()
+	if err != nil {
+		return 0
+	}
+	return t1.Weekday()
+}
+
+func oldYearDay(t mysqlTime) int {
+	t1, err := t.GoTime()
+	if err != nil {
+		return 0
+	}
+	return t1.YearDay()
+}
+
+func oldISOWeek(t mysqlTime) (int, int) {
+	t1, err := t.GoTime()
+	if err != nil {
+		return 0, 0
+	}
+	return t1.ISOWeek()
+}
+
+// sampleDates returns a spread of non-zero dates across 1-9999, covering
+// every month and a range of days, used by both the correctness and
+// benchmark tests below.
+func sampleDates() []mysqlTime {
+	var dates []mysqlTime
+	for year := 1; year <= 9999; year += 7 {
+		for month := 1; month <= 12; month++ {
+			for _, day := range []int{1, 15, 28} {
+				dates = append(dates, mkTime(year, month, day, 0, 0, 0, 0))
+			}
+		}
+	}
+	return dates
+}
+
+// TestWeekdayYearDayISOWeekMatchesOld checks that the new Julian-day-number
+// fast path agrees with the old GoTime-based implementation for every
+// non-zero date in sampleDates.
+func TestWeekdayYearDayISOWeekMatchesOld(t *testing.T) {
+	for _, d := range sampleDates() {
+		if got, want := d.Weekday(), oldWeekday(d); got != want {
+			t.Fatalf("%04d-%02d-%02d: Weekday() = %v, want %v", d.Year(), d.Month(), d.Day(), got, want)
+		}
+		if got, want := d.YearDay(), oldYearDay(d); got != want {
+			t.Fatalf("%04d-%02d-%02d: YearDay() = %d, want %d", d.Year(), d.Month(), d.Day(), got, want)
+		}
+		gy, gw := d.ISOWeek()
+		wy, ww := oldISOWeek(d)
+		if gy != wy || gw != ww {
+			t.Fatalf("%04d-%02d-%02d: ISOWeek() = (%d, %d), want (%d, %d)", d.Year(), d.Month(), d.Day(), gy, gw, wy, ww)
+		}
+	}
+}
+
+// TestWeekdayYearDayISOWeekZeroDate checks that the fast path returns zero
+// values directly for dates GoTime can't represent losslessly,
+// instead of silently going through Go's month/day normalization.
+func TestWeekdayYearDayISOWeekZeroDate(t *testing.T) {
+	for _, d := range []mysqlTime{
+		mkTime(2021, 0, 1, 0, 0, 0, 0),
+		mkTime(2021, 1, 0, 0, 0, 0, 0),
+		mkTime(0, 0, 0, 0, 0, 0, 0),
+	} {
+		if wd := d.Weekday(); wd != 0 {
+			t.Fatalf("%+v: Weekday() = %v, want 0", d, wd)
+		}
+		if yd := d.YearDay(); yd != 0 {
+			t.Fatalf("%+v: YearDay() = %d, want 0", d, yd)
+		}
+		if y, w := d.ISOWeek(); y != 0 || w != 0 {
+			t.Fatalf("%+v: ISOWeek() = (%d, %d), want (0, 0)", d, y, w)
+		}
+	}
+}
+
+func BenchmarkWeekdayOld(b *testing.B) {
+	d := mkTime(2021, 6, 15, 0, 0, 0, 0)
+	for i := 0; i < b.N; i++ {
+		oldWeekday(d)
+	}
+}
+
+func BenchmarkWeekdayNew(b *testing.B) {
+	d := mkTime(2021, 6, 15, 0, 0, 0, 0)
+	for i := 0; i < b.N; i++ {
+		d.Weekday()
+	}
+}
+
+func BenchmarkISOWeekOld(b *testing.B) {
+	d := mkTime(2021, 6, 15, 0, 0, 0, 0)
+	for i := 0; i < b.N; i++ {
+		oldISOWeek(d)
+	}
+}
+
+func BenchmarkISOWeekNew(b *testing.B) {
+	d := mkTime(2021, 6, 15, 0, 0, 0, 0)
+	for i := 0; i < b.N; i++ {
+		d.ISOWeek()
+	}
+}
+
+// TestFormatParseISOWeekRoundTrip checks that FormatISOWeek and
+// ParseISOWeekDate are inverses, in both the extended (YYYY-Www-D) and
+// compact (YYYYWwwD) forms, across a spread of dates.
+func TestFormatParseISOWeekRoundTrip(t *testing.T) {
+	for _, d := range sampleDates() {
+		for _, extended := range []bool{true, false} {
+			s := d.FormatISOWeek(extended)
+			got, err := ParseISOWeekDate(s)
+			if err != nil {
+				t.Fatalf("ParseISOWeekDate(%q): %v", s, err)
+			}
+			if got.Year() != d.Year() || got.Month() != d.Month() || got.Day() != d.Day() {
+				t.Fatalf("ParseISOWeekDate(%q) = %04d-%02d-%02d, want %04d-%02d-%02d",
+					s, got.Year(), got.Month(), got.Day(), d.Year(), d.Month(), d.Day())
+			}
+		}
+	}
+}
+
+// TestParseISOWeekDateForms checks each accepted form; the week-only forms
+// (no day-of-week component) default to the Monday of that ISO week.
+func TestParseISOWeekDateForms(t *testing.T) {
+	cases := []struct {
+		s                string
+		year, month, day int
+	}{
+		{"2021-W01", 2021, 1, 4},
+		{"2021W01", 2021, 1, 4},
+		{"2021-W01-1", 2021, 1, 4},
+		{"2021W011", 2021, 1, 4},
+		{"2021-W01-7", 2021, 1, 10},
+	}
+	for _, c := range cases {
+		got, err := ParseISOWeekDate(c.s)
+		if err != nil {
+			t.Fatalf("ParseISOWeekDate(%q): %v", c.s, err)
+		}
+		if got.Year() != c.year || got.Month() != c.month || got.Day() != c.day {
+			t.Fatalf("ParseISOWeekDate(%q) = %04d-%02d-%02d, want %04d-%02d-%02d",
+				c.s, got.Year(), got.Month(), got.Day(), c.year, c.month, c.day)
+		}
+	}
+}
+
+// TestParseISOWeekDateRejectsNonexistentWeek53 checks that W53 is rejected
+// for a week-numbering year that only has 52 weeks.
+func TestParseISOWeekDateRejectsNonexistentWeek53(t *testing.T) {
+	if isoYearHas53Weeks(2021) {
+		t.Fatalf("test assumption violated: 2021 must not have 53 ISO weeks")
+	}
+	if _, err := ParseISOWeekDate("2021-W53-1"); err == nil {
+		t.Fatalf("2021-W53-1 should be rejected: 2021 only has 52 ISO weeks")
+	}
+}